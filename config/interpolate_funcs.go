@@ -1,6 +1,7 @@
 package config
 
 import (
+	"bytes"
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
@@ -9,18 +10,24 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"html"
 	"io/ioutil"
 	"net"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"unicode/utf8"
 
 	"github.com/apparentlymart/go-cidr/cidr"
 	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/go-version"
 	"github.com/hashicorp/hil"
 	"github.com/hashicorp/hil/ast"
 	"github.com/mitchellh/go-homedir"
+	"github.com/rainycape/unidecode"
 )
 
 // stringSliceToVariableValue converts a string slice into the value
@@ -51,38 +58,65 @@ func listVariableValueToStringSlice(values []ast.Variable) ([]string, error) {
 // Funcs is the mapping of built-in functions for configuration.
 func Funcs() map[string]ast.Function {
 	return map[string]ast.Function{
-		"base64decode": interpolationFuncBase64Decode(),
-		"base64encode": interpolationFuncBase64Encode(),
-		"base64sha256": interpolationFuncBase64Sha256(),
-		"cidrhost":     interpolationFuncCidrHost(),
-		"cidrnetmask":  interpolationFuncCidrNetmask(),
-		"cidrsubnet":   interpolationFuncCidrSubnet(),
-		"coalesce":     interpolationFuncCoalesce(),
-		"compact":      interpolationFuncCompact(),
-		"concat":       interpolationFuncConcat(),
-		"distinct":     interpolationFuncDistinct(),
-		"element":      interpolationFuncElement(),
-		"file":         interpolationFuncFile(),
-		"format":       interpolationFuncFormat(),
-		"formatlist":   interpolationFuncFormatList(),
-		"index":        interpolationFuncIndex(),
-		"join":         interpolationFuncJoin(),
-		"jsonencode":   interpolationFuncJSONEncode(),
-		"length":       interpolationFuncLength(),
-		"list":         interpolationFuncList(),
-		"lower":        interpolationFuncLower(),
-		"map":          interpolationFuncMap(),
-		"md5":          interpolationFuncMd5(),
-		"merge":        interpolationFuncMerge(),
-		"uuid":         interpolationFuncUUID(),
-		"replace":      interpolationFuncReplace(),
-		"sha1":         interpolationFuncSha1(),
-		"sha256":       interpolationFuncSha256(),
-		"signum":       interpolationFuncSignum(),
-		"sort":         interpolationFuncSort(),
-		"split":        interpolationFuncSplit(),
-		"trimspace":    interpolationFuncTrimSpace(),
-		"upper":        interpolationFuncUpper(),
+		"backoff":           interpolationFuncBackoff(),
+		"base64decode":      interpolationFuncBase64Decode(),
+		"base64encode":      interpolationFuncBase64Encode(),
+		"base64sha256":      interpolationFuncBase64Sha256(),
+		"checksum":          interpolationFuncChecksum(),
+		"cidrhost":          interpolationFuncCidrHost(),
+		"cidrnetmask":       interpolationFuncCidrNetmask(),
+		"cidrsubnet":        interpolationFuncCidrSubnet(),
+		"coalesce":          interpolationFuncCoalesce(),
+		"commonprefix":      interpolationFuncCommonPrefix(),
+		"compact":           interpolationFuncCompact(),
+		"concat":            interpolationFuncConcat(),
+		"contains":          interpolationFuncContains(),
+		"deepmerge":         interpolationFuncDeepMerge(),
+		"default":           interpolationFuncDefault(),
+		"dig":               interpolationFuncDig(),
+		"distinct":          interpolationFuncDistinct(),
+		"element":           interpolationFuncElement(),
+		"escape":            interpolationFuncEscape(),
+		"file":              interpolationFuncFile(),
+		"format":            interpolationFuncFormat(),
+		"formatlist":        interpolationFuncFormatList(),
+		"index":             interpolationFuncIndex(),
+		"indexof_or":        interpolationFuncIndexOfOr(),
+		"interleave":        interpolationFuncInterleave(),
+		"join":              interpolationFuncJoin(),
+		"jsonencode":        interpolationFuncJSONEncode(),
+		"length":            interpolationFuncLength(),
+		"list":              interpolationFuncList(),
+		"lower":             interpolationFuncLower(),
+		"map":               interpolationFuncMap(),
+		"maptolist":         interpolationFuncMapToList(),
+		"md5":               interpolationFuncMd5(),
+		"merge":             interpolationFuncMerge(),
+		"padleft":           interpolationFuncPad("padleft", true),
+		"padright":          interpolationFuncPad("padright", false),
+		"regexcapture":      interpolationFuncRegexCapture(),
+		"regexcapturenamed": interpolationFuncRegexCaptureNamed(),
+		"regexsplit":        interpolationFuncRegexSplit(),
+		"regexvalidate":     interpolationFuncRegexValidate(),
+		"uuid":              interpolationFuncUUID(),
+		"replace":           interpolationFuncReplace(),
+		"replace_ci":        interpolationFuncReplaceCI(),
+		"sha1":              interpolationFuncSha1(),
+		"sha256":            interpolationFuncSha256(),
+		"signum":            interpolationFuncSignum(),
+		"similarity":        interpolationFuncSimilarity(),
+		"slugify":           interpolationFuncSlugify(),
+		"sort":              interpolationFuncSort(),
+		"split":             interpolationFuncSplit(),
+		"tomap_by":          interpolationFuncToMapBy(),
+		"trim":              interpolationFuncTrim(),
+		"trimprefix":        interpolationFuncTrimPrefix(),
+		"trimspace":         interpolationFuncTrimSpace(),
+		"trimsuffix":        interpolationFuncTrimSuffix(),
+		"upper":             interpolationFuncUpper(),
+		"versioncompare":    interpolationFuncVersionCompare(),
+		"versionsatisfies":  interpolationFuncVersionSatisfies(),
+		"weightedchoice":    interpolationFuncWeightedChoice(),
 	}
 }
 
@@ -198,6 +232,39 @@ func interpolationFuncCompact() ast.Function {
 	}
 }
 
+// interpolationFuncCommonPrefix implements the "commonprefix" function that
+// returns the longest string that every element of a list starts with. The
+// prefix always ends on a character boundary.
+func interpolationFuncCommonPrefix() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeList},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			elements, err := listVariableValueToStringSlice(args[0].([]ast.Variable))
+			if err != nil {
+				return nil, err
+			}
+			if len(elements) == 0 {
+				return "", nil
+			}
+
+			prefix := []rune(elements[0])
+			for _, element := range elements[1:] {
+				i := 0
+				for _, r := range element {
+					if i >= len(prefix) || prefix[i] != r {
+						break
+					}
+					i++
+				}
+				prefix = prefix[:i]
+			}
+
+			return string(prefix), nil
+		},
+	}
+}
+
 // interpolationFuncCidrHost implements the "cidrhost" function that
 // fills in the host part of a CIDR range address to create a single
 // host address
@@ -308,6 +375,24 @@ func interpolationFuncCoalesce() ast.Function {
 	}
 }
 
+// interpolationFuncDefault implements the "default" function that returns
+// its first argument unless it is the empty string, in which case the
+// fallback is returned instead. Numbers are converted to strings before
+// the check, so zero is never considered empty.
+func interpolationFuncDefault() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString, ast.TypeString},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			if value := args[0].(string); value != "" {
+				return value, nil
+			}
+
+			return args[1].(string), nil
+		},
+	}
+}
+
 // interpolationFuncConcat implements the "concat" function that concatenates
 // multiple lists.
 func interpolationFuncConcat() ast.Function {
@@ -349,6 +434,119 @@ func interpolationFuncConcat() ast.Function {
 	}
 }
 
+// interpolationFuncContains implements the "contains" function that checks
+// whether a list has the given element or a map has the given key. The
+// result is the string "true" or "false", matching how Terraform reads
+// boolean values from configuration.
+func interpolationFuncContains() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeAny, ast.TypeString},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			needle := args[1].(string)
+
+			found := false
+			switch collection := args[0].(type) {
+			case []ast.Variable:
+				for _, element := range collection {
+					if element.Type == ast.TypeString && element.Value.(string) == needle {
+						found = true
+						break
+					}
+				}
+			case map[string]ast.Variable:
+				_, found = collection[needle]
+			default:
+				return nil, fmt.Errorf("first argument must be a list or a map")
+			}
+
+			return strconv.FormatBool(found), nil
+		},
+	}
+}
+
+// jsonHTMLUnescaper reverses the escaping of HTML characters that
+// json.Marshal always applies. Escaped backslashes are matched first so a
+// literal "\\u003c" in the input is left alone.
+var jsonHTMLUnescaper = strings.NewReplacer(
+	`\\`, `\\`,
+	`\u003c`, "<",
+	`\u003e`, ">",
+	`\u0026`, "&",
+)
+
+// interpolationFuncEscape implements the "escape" function that escapes a
+// string for embedding in another format. The supported targets are "json"
+// (the contents of a JSON string, without the surrounding quotes), "shell"
+// (a single-quoted POSIX shell word) and "html" (HTML text or a quoted
+// attribute value).
+func interpolationFuncEscape() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString, ast.TypeString},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			s := args[0].(string)
+
+			switch target := args[1].(string); target {
+			case "json":
+				encoded, err := json.Marshal(s)
+				if err != nil {
+					return nil, err
+				}
+
+				// Undo the HTML escaping done by json.Marshal and strip the
+				// surrounding quotes
+				unescaped := jsonHTMLUnescaper.Replace(string(encoded))
+				return unescaped[1 : len(unescaped)-1], nil
+			case "shell":
+				return "'" + strings.Replace(s, "'", `'\''`, -1) + "'", nil
+			case "html":
+				return html.EscapeString(s), nil
+			default:
+				return nil, fmt.Errorf(
+					"unsupported target %q, must be one of \"json\", \"shell\" or \"html\"",
+					target)
+			}
+		},
+	}
+}
+
+// interpolationFuncInterleave implements the "interleave" function that
+// builds a list by alternating elements of two lists. When one list is
+// longer, its remaining elements are appended at the end.
+func interpolationFuncInterleave() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeList, ast.TypeList},
+		ReturnType: ast.TypeList,
+		Callback: func(args []interface{}) (interface{}, error) {
+			a := args[0].([]ast.Variable)
+			b := args[1].([]ast.Variable)
+
+			outputList := make([]ast.Variable, 0, len(a)+len(b))
+			for i := 0; i < len(a) || i < len(b); i++ {
+				if i < len(a) {
+					outputList = append(outputList, a[i])
+				}
+				if i < len(b) {
+					outputList = append(outputList, b[i])
+				}
+			}
+
+			// we don't support heterogeneous types, so make sure all types match the first
+			if len(outputList) > 0 {
+				firstType := outputList[0].Type
+				for _, v := range outputList[1:] {
+					if v.Type != firstType {
+						return nil, fmt.Errorf("unexpected %s in list of %s", v.Type.Printable(), firstType.Printable())
+					}
+				}
+			}
+
+			return outputList, nil
+		},
+	}
+}
+
 // interpolationFuncFile implements the "file" function that allows
 // loading contents from a file.
 func interpolationFuncFile() ast.Function {
@@ -472,6 +670,26 @@ func interpolationFuncIndex() ast.Function {
 	}
 }
 
+// interpolationFuncIndexOfOr implements the "indexof_or" function that
+// behaves like "index" but returns the given default rather than failing
+// when the element is not in the list.
+func interpolationFuncIndexOfOr() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeList, ast.TypeString, ast.TypeInt},
+		ReturnType: ast.TypeInt,
+		Callback: func(args []interface{}) (interface{}, error) {
+			haystack := args[0].([]ast.Variable)
+			needle := args[1].(string)
+			for index, element := range haystack {
+				if needle == element.Value {
+					return index, nil
+				}
+			}
+			return args[2].(int), nil
+		},
+	}
+}
+
 // interpolationFuncDistinct implements the "distinct" function that
 // removes duplicate elements from a list.
 func interpolationFuncDistinct() ast.Function {
@@ -626,6 +844,201 @@ func interpolationFuncReplace() ast.Function {
 	}
 }
 
+// regexpCache holds the compiled form of every pattern given to the regular
+// expression functions, since the same pattern is often evaluated once per
+// resource when count is used.
+var regexpCache = struct {
+	sync.Mutex
+	m map[string]*regexp.Regexp
+}{m: make(map[string]*regexp.Regexp)}
+
+// compileRegexp returns the compiled form of the given pattern, reusing a
+// previous compilation if there was one.
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	regexpCache.Lock()
+	defer regexpCache.Unlock()
+
+	if re, ok := regexpCache.m[pattern]; ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %s", err)
+	}
+
+	regexpCache.m[pattern] = re
+	return re, nil
+}
+
+// interpolationFuncRegexCapture implements the "regexcapture" function that
+// returns the capture groups of the first match of a regular expression,
+// or an empty list if there is no match.
+func interpolationFuncRegexCapture() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString, ast.TypeString},
+		ReturnType: ast.TypeList,
+		Callback: func(args []interface{}) (interface{}, error) {
+			re, err := compileRegexp(args[1].(string))
+			if err != nil {
+				return nil, err
+			}
+
+			match := re.FindStringSubmatch(args[0].(string))
+			if match == nil {
+				return stringSliceToVariableValue(nil), nil
+			}
+
+			return stringSliceToVariableValue(match[1:]), nil
+		},
+	}
+}
+
+// interpolationFuncRegexCaptureNamed implements the "regexcapturenamed"
+// function that returns the named capture groups of the first match of a
+// regular expression as a map, or an empty map if there is no match.
+func interpolationFuncRegexCaptureNamed() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString, ast.TypeString},
+		ReturnType: ast.TypeMap,
+		Callback: func(args []interface{}) (interface{}, error) {
+			re, err := compileRegexp(args[1].(string))
+			if err != nil {
+				return nil, err
+			}
+
+			outputMap := make(map[string]ast.Variable)
+			match := re.FindStringSubmatch(args[0].(string))
+			if match == nil {
+				return outputMap, nil
+			}
+
+			for i, name := range re.SubexpNames() {
+				if i == 0 || name == "" {
+					continue
+				}
+
+				outputMap[name] = ast.Variable{
+					Type:  ast.TypeString,
+					Value: match[i],
+				}
+			}
+
+			return outputMap, nil
+		},
+	}
+}
+
+// interpolationFuncRegexSplit implements the "regexsplit" function that
+// splits a string into a list around matches of a regular expression. An
+// optional third argument limits the number of substrings returned, with
+// the final substring holding the unsplit remainder.
+func interpolationFuncRegexSplit() ast.Function {
+	return ast.Function{
+		ArgTypes:     []ast.Type{ast.TypeString, ast.TypeString},
+		ReturnType:   ast.TypeList,
+		Variadic:     true,
+		VariadicType: ast.TypeInt,
+		Callback: func(args []interface{}) (interface{}, error) {
+			if len(args) > 3 {
+				return nil, fmt.Errorf("regexsplit() takes no more than three arguments")
+			}
+
+			s := args[0].(string)
+			re, err := compileRegexp(args[1].(string))
+			if err != nil {
+				return nil, err
+			}
+
+			limit := -1
+			if len(args) == 3 {
+				limit = args[2].(int)
+				if limit < 1 {
+					return nil, fmt.Errorf("limit must be a positive number, got %d", limit)
+				}
+			}
+
+			return stringSliceToVariableValue(re.Split(s, limit)), nil
+		},
+	}
+}
+
+// interpolationFuncReplaceCI implements the "replace_ci" function that
+// replaces every occurrence of a substring regardless of case. Matches are
+// found left to right and do not overlap, and text outside the matches is
+// left as it was.
+func interpolationFuncReplaceCI() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString, ast.TypeString, ast.TypeString},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			s := args[0].(string)
+			search := args[1].(string)
+			replace := args[2].(string)
+
+			if search == "" {
+				return strings.Replace(s, search, replace, -1), nil
+			}
+
+			input := []rune(s)
+			needle := []rune(search)
+
+			var buf bytes.Buffer
+			for i := 0; i < len(input); {
+				if hasPrefixFold(input[i:], needle) {
+					buf.WriteString(replace)
+					i += len(needle)
+					continue
+				}
+
+				buf.WriteRune(input[i])
+				i++
+			}
+
+			return buf.String(), nil
+		},
+	}
+}
+
+// hasPrefixFold reports whether s begins with prefix under Unicode simple
+// case folding.
+func hasPrefixFold(s, prefix []rune) bool {
+	if len(s) < len(prefix) {
+		return false
+	}
+
+	for i, r := range prefix {
+		if !strings.EqualFold(string(s[i]), string(r)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// interpolationFuncRegexValidate implements the "regexvalidate" function
+// that returns its input unchanged if it matches a regular expression, and
+// otherwise fails with the given message.
+func interpolationFuncRegexValidate() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString, ast.TypeString, ast.TypeString},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			s := args[0].(string)
+			re, err := compileRegexp(args[1].(string))
+			if err != nil {
+				return nil, err
+			}
+
+			if !re.MatchString(s) {
+				return nil, errors.New(args[2].(string))
+			}
+
+			return s, nil
+		},
+	}
+}
+
 func interpolationFuncLength() ast.Function {
 	return ast.Function{
 		ArgTypes:   []ast.Type{ast.TypeAny},
@@ -648,6 +1061,49 @@ func interpolationFuncLength() ast.Function {
 	}
 }
 
+// interpolationFuncBackoff implements the "backoff" function that returns a
+// list of retry delays, in seconds, that double from base with each attempt
+// and never exceed max.
+func interpolationFuncBackoff() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeInt, ast.TypeInt, ast.TypeInt},
+		ReturnType: ast.TypeList,
+		Callback: func(args []interface{}) (interface{}, error) {
+			base := args[0].(int)
+			max := args[1].(int)
+			attempts := args[2].(int)
+
+			if base <= 0 {
+				return nil, fmt.Errorf("base must be a positive number, got %d", base)
+			}
+			if max <= 0 {
+				return nil, fmt.Errorf("max must be a positive number, got %d", max)
+			}
+			if attempts < 0 {
+				return nil, fmt.Errorf("attempts must not be negative, got %d", attempts)
+			}
+
+			delays := make([]string, attempts)
+			delay := base
+			for i := range delays {
+				if delay > max {
+					delay = max
+				}
+				delays[i] = strconv.Itoa(delay)
+
+				// Cap before doubling so the delay can't overflow
+				if delay > max/2 {
+					delay = max
+				} else {
+					delay *= 2
+				}
+			}
+
+			return stringSliceToVariableValue(delays), nil
+		},
+	}
+}
+
 func interpolationFuncSignum() ast.Function {
 	return ast.Function{
 		ArgTypes:   []ast.Type{ast.TypeInt},
@@ -667,6 +1123,103 @@ func interpolationFuncSignum() ast.Function {
 	}
 }
 
+// interpolationFuncSimilarity implements the "similarity" function that
+// scores how alike two strings are, from 0 (nothing in common) to 1
+// (identical). The score is derived from the Levenshtein distance between
+// the two strings, measured in runes, relative to the longer of the two.
+// Two empty strings are considered identical.
+func interpolationFuncSimilarity() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString, ast.TypeString},
+		ReturnType: ast.TypeFloat,
+		Callback: func(args []interface{}) (interface{}, error) {
+			a := args[0].(string)
+			b := args[1].(string)
+
+			longest := utf8.RuneCountInString(a)
+			if n := utf8.RuneCountInString(b); n > longest {
+				longest = n
+			}
+			if longest == 0 {
+				return 1.0, nil
+			}
+
+			distance := levenshteinDistance(a, b)
+			return 1 - float64(distance)/float64(longest), nil
+		},
+	}
+}
+
+// levenshteinDistance returns the number of single character insertions,
+// deletions and substitutions needed to turn a into b. Characters are
+// compared as runes rather than bytes.
+func levenshteinDistance(a, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+
+	// Only the previous row of the distance matrix is needed at any time
+	row := make([]int, len(rb)+1)
+	for j := range row {
+		row[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		prev := row[0]
+		row[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			current := row[j]
+			row[j] = prev + cost
+			if d := row[j-1] + 1; d < row[j] {
+				row[j] = d
+			}
+			if d := current + 1; d < row[j] {
+				row[j] = d
+			}
+			prev = current
+		}
+	}
+
+	return row[len(rb)]
+}
+
+// interpolationFuncSlugify implements the "slugify" function that turns a
+// string into a lowercase identifier safe for use in DNS labels and most
+// resource names. Non-ASCII characters are first transliterated to their
+// closest ASCII form, then every run of characters other than letters and
+// digits becomes a single hyphen. Leading and trailing hyphens are removed.
+func interpolationFuncSlugify() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			s := strings.ToLower(unidecode.Unidecode(args[0].(string)))
+
+			var buf bytes.Buffer
+			separate := false
+			for i := 0; i < len(s); i++ {
+				c := s[i]
+				if ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') {
+					if separate && buf.Len() > 0 {
+						buf.WriteByte('-')
+					}
+					buf.WriteByte(c)
+					separate = false
+					continue
+				}
+
+				separate = true
+			}
+
+			return buf.String(), nil
+		},
+	}
+}
+
 // interpolationFuncSort sorts a list of a strings lexographically
 func interpolationFuncSort() ast.Function {
 	return ast.Function{
@@ -710,7 +1263,48 @@ func interpolationFuncSplit() ast.Function {
 	}
 }
 
-// interpolationFuncLookup implements the "lookup" function that allows
+// interpolationFuncToMapBy implements the "tomap_by" function that turns a
+// list of maps into a map of those same maps, keyed by the value each one
+// has for the given key. Duplicate keys are an error rather than having
+// one element silently replace another.
+func interpolationFuncToMapBy() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeList, ast.TypeString},
+		ReturnType: ast.TypeMap,
+		Callback: func(args []interface{}) (interface{}, error) {
+			list := args[0].([]ast.Variable)
+			field := args[1].(string)
+
+			outputMap := make(map[string]ast.Variable)
+			for i, element := range list {
+				if element.Type != ast.TypeMap {
+					return nil, fmt.Errorf(
+						"element %d must be a map, got %s", i, element.Type.Printable())
+				}
+
+				keyVar, ok := element.Value.(map[string]ast.Variable)[field]
+				if !ok {
+					return nil, fmt.Errorf("element %d has no key %q", i, field)
+				}
+				if keyVar.Type != ast.TypeString {
+					return nil, fmt.Errorf(
+						"element %d has %s for key %q, must be a string",
+						i, keyVar.Type.Printable(), field)
+				}
+
+				key := keyVar.Value.(string)
+				if _, ok := outputMap[key]; ok {
+					return nil, fmt.Errorf("element %d has duplicate key %q", i, key)
+				}
+				outputMap[key] = element
+			}
+
+			return outputMap, nil
+		},
+	}
+}
+
+// interpolationFuncLookup implements the "lookup" function that allows
 // dynamic lookups of map types within a Terraform configuration.
 func interpolationFuncLookup(vs map[string]ast.Variable) ast.Function {
 	return ast.Function{
@@ -784,6 +1378,60 @@ func interpolationFuncElement() ast.Function {
 	}
 }
 
+// interpolationFuncDig implements the "dig" function that traverses nested
+// lists and maps by a dotted path, such as "a.b.0.c". Numeric segments
+// index into lists and all other segments are map keys.
+func interpolationFuncDig() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeAny, ast.TypeString},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			current := args[0]
+			path := args[1].(string)
+			if path == "" {
+				return nil, fmt.Errorf("path must not be empty")
+			}
+
+			for _, segment := range strings.Split(path, ".") {
+				switch typed := current.(type) {
+				case map[string]ast.Variable:
+					v, ok := typed[segment]
+					if !ok {
+						return nil, fmt.Errorf(
+							"key %q does not exist in path %q", segment, path)
+					}
+					current = v.Value
+				case []ast.Variable:
+					index, err := strconv.Atoi(segment)
+					if err != nil {
+						return nil, fmt.Errorf(
+							"segment %q of path %q must be a number to index a list",
+							segment, path)
+					}
+					if index < 0 || index >= len(typed) {
+						return nil, fmt.Errorf(
+							"index %d of path %q out of range for list of %d elements",
+							index, path, len(typed))
+					}
+					current = typed[index].Value
+				default:
+					return nil, fmt.Errorf(
+						"segment %q of path %q cannot index into a value of type %T",
+						segment, path, current)
+				}
+			}
+
+			s, ok := current.(string)
+			if !ok {
+				return nil, fmt.Errorf(
+					"path %q must refer to a string value", path)
+			}
+
+			return s, nil
+		},
+	}
+}
+
 // interpolationFuncKeys implements the "keys" function that yields a list of
 // keys of map types within a Terraform configuration.
 func interpolationFuncKeys(vs map[string]ast.Variable) ast.Function {
@@ -842,6 +1490,48 @@ func interpolationFuncValues(vs map[string]ast.Variable) ast.Function {
 	}
 }
 
+// interpolationFuncMapToList implements the "maptolist" function that turns
+// a flat map into a list of "key=value" strings sorted by key. An optional
+// second argument replaces the "=" separator.
+func interpolationFuncMapToList() ast.Function {
+	return ast.Function{
+		ArgTypes:     []ast.Type{ast.TypeMap},
+		ReturnType:   ast.TypeList,
+		Variadic:     true,
+		VariadicType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			if len(args) > 2 {
+				return nil, fmt.Errorf("maptolist() takes no more than two arguments")
+			}
+
+			mapVar := args[0].(map[string]ast.Variable)
+			sep := "="
+			if len(args) == 2 {
+				sep = args[1].(string)
+			}
+
+			keys := make([]string, 0, len(mapVar))
+			for k := range mapVar {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			list := make([]string, len(keys))
+			for i, k := range keys {
+				value, ok := mapVar[k].Value.(string)
+				if !ok {
+					return nil, fmt.Errorf(
+						"maptolist() may only be used with flat maps, %q has element of %s",
+						k, mapVar[k].Type.Printable())
+				}
+				list[i] = k + sep + value
+			}
+
+			return stringSliceToVariableValue(list), nil
+		},
+	}
+}
+
 // interpolationFuncBase64Encode implements the "base64encode" function that
 // allows Base64 encoding.
 func interpolationFuncBase64Encode() ast.Function {
@@ -919,6 +1609,97 @@ func interpolationFuncMerge() ast.Function {
 	}
 }
 
+// interpolationFuncDeepMerge implements the "deepmerge" function that
+// behaves like "merge" except that where two maps both hold a map under the
+// same key, those nested maps are merged as well. Any other value, including
+// a list or a value whose type differs from the one it replaces, is taken
+// from the later map. The input maps are not modified.
+func interpolationFuncDeepMerge() ast.Function {
+	return ast.Function{
+		ArgTypes:     []ast.Type{ast.TypeMap},
+		ReturnType:   ast.TypeMap,
+		Variadic:     true,
+		VariadicType: ast.TypeMap,
+		Callback: func(args []interface{}) (interface{}, error) {
+			outputMap := make(map[string]ast.Variable)
+
+			for _, arg := range args {
+				outputMap = deepMergeMaps(outputMap, arg.(map[string]ast.Variable))
+			}
+
+			return outputMap, nil
+		},
+	}
+}
+
+// deepMergeMaps returns a new map with the entries of src recursively
+// merged over those of dst.
+func deepMergeMaps(dst, src map[string]ast.Variable) map[string]ast.Variable {
+	result := make(map[string]ast.Variable, len(dst)+len(src))
+	for k, v := range dst {
+		result[k] = v
+	}
+
+	for k, v := range src {
+		existing, ok := result[k]
+		if ok && existing.Type == ast.TypeMap && v.Type == ast.TypeMap {
+			v = ast.Variable{
+				Type: ast.TypeMap,
+				Value: deepMergeMaps(
+					existing.Value.(map[string]ast.Variable),
+					v.Value.(map[string]ast.Variable)),
+			}
+		}
+		result[k] = v
+	}
+
+	return result
+}
+
+// interpolationFuncPad implements the "padleft" and "padright" functions that
+// pad a string to the given width, counted in characters. The pad string
+// defaults to a single space and is repeated, and cut short if needed, to
+// fill exactly the missing width. Strings already at least as wide as the
+// width are returned unchanged.
+func interpolationFuncPad(name string, left bool) ast.Function {
+	return ast.Function{
+		ArgTypes:     []ast.Type{ast.TypeString, ast.TypeInt},
+		ReturnType:   ast.TypeString,
+		Variadic:     true,
+		VariadicType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			if len(args) > 3 {
+				return nil, fmt.Errorf("%s() takes no more than three arguments", name)
+			}
+
+			s := args[0].(string)
+			width := args[1].(int)
+			pad := []rune(" ")
+			if len(args) == 3 {
+				pad = []rune(args[2].(string))
+				if len(pad) == 0 {
+					return nil, fmt.Errorf("pad string must not be empty")
+				}
+			}
+
+			missing := width - utf8.RuneCountInString(s)
+			if missing <= 0 {
+				return s, nil
+			}
+
+			padding := make([]rune, missing)
+			for i := range padding {
+				padding[i] = pad[i%len(pad)]
+			}
+
+			if left {
+				return string(padding) + s, nil
+			}
+			return s + string(padding), nil
+		},
+	}
+}
+
 // interpolationFuncUpper implements the "upper" function that does
 // string upper casing.
 func interpolationFuncUpper() ast.Function {
@@ -961,6 +1742,72 @@ func interpolationFuncSha256() ast.Function {
 	}
 }
 
+// interpolationFuncChecksum implements the "checksum" function that
+// computes a single SHA-256 hash over every string in a list. Each element
+// is hashed on its own and the hashes are sorted before being combined, so
+// the result does not depend on the order of the list.
+func interpolationFuncChecksum() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeList},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			elements, err := listVariableValueToStringSlice(args[0].([]ast.Variable))
+			if err != nil {
+				return nil, err
+			}
+
+			sums := make([]string, len(elements))
+			for i, element := range elements {
+				sum := sha256.Sum256([]byte(element))
+				sums[i] = hex.EncodeToString(sum[:])
+			}
+			sort.Strings(sums)
+
+			h := sha256.New()
+			for _, sum := range sums {
+				h.Write([]byte(sum))
+			}
+			return hex.EncodeToString(h.Sum(nil)), nil
+		},
+	}
+}
+
+// interpolationFuncTrim implements the "trim" function that removes every
+// leading and trailing character found in the given cutset.
+func interpolationFuncTrim() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString, ast.TypeString},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			return strings.Trim(args[0].(string), args[1].(string)), nil
+		},
+	}
+}
+
+// interpolationFuncTrimPrefix implements the "trimprefix" function that
+// removes a prefix from a string if it is present.
+func interpolationFuncTrimPrefix() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString, ast.TypeString},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			return strings.TrimPrefix(args[0].(string), args[1].(string)), nil
+		},
+	}
+}
+
+// interpolationFuncTrimSuffix implements the "trimsuffix" function that
+// removes a suffix from a string if it is present.
+func interpolationFuncTrimSuffix() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString, ast.TypeString},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			return strings.TrimSuffix(args[0].(string), args[1].(string)), nil
+		},
+	}
+}
+
 func interpolationFuncTrimSpace() ast.Function {
 	return ast.Function{
 		ArgTypes:   []ast.Type{ast.TypeString},
@@ -996,3 +1843,264 @@ func interpolationFuncUUID() ast.Function {
 		},
 	}
 }
+
+// interpolationFuncVersionCompare implements the "versioncompare" function
+// that returns -1, 0 or 1 if the first version is lower than, equal to or
+// higher than the second. Pre-release versions sort before the release
+// they precede and build metadata is ignored.
+func interpolationFuncVersionCompare() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString, ast.TypeString},
+		ReturnType: ast.TypeInt,
+		Callback: func(args []interface{}) (interface{}, error) {
+			a, err := version.NewVersion(args[0].(string))
+			if err != nil {
+				return nil, err
+			}
+			b, err := version.NewVersion(args[1].(string))
+			if err != nil {
+				return nil, err
+			}
+
+			return compareVersions(a, b), nil
+		},
+	}
+}
+
+// interpolationFuncVersionSatisfies implements the "versionsatisfies"
+// function that checks a version against a comma-separated list of
+// constraints such as ">= 1.2.0, < 2.0.0". The result is the string "true"
+// or "false".
+func interpolationFuncVersionSatisfies() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString, ast.TypeString},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			v, err := version.NewVersion(args[0].(string))
+			if err != nil {
+				return nil, err
+			}
+
+			// Parse every constraint before checking any so a malformed
+			// constraint is always reported
+			rawConstraints := strings.Split(args[1].(string), ",")
+			constraints := make([]*versionConstraint, len(rawConstraints))
+			for i, raw := range rawConstraints {
+				constraints[i], err = parseVersionConstraint(raw)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			for _, c := range constraints {
+				if !c.check(v) {
+					return "false", nil
+				}
+			}
+
+			return "true", nil
+		},
+	}
+}
+
+// versionConstraintRegexp matches a single version constraint. Longer
+// operators are listed first so ">=" isn't read as ">".
+var versionConstraintRegexp = regexp.MustCompile(
+	`^\s*(~>|>=|<=|!=|>|<|=)?\s*(` + version.VersionRegexpRaw + `)\s*$`)
+
+// versionConstraint is a single parsed version constraint. segments is the
+// number of release segments written in the constraint, which the "~>"
+// operator needs.
+type versionConstraint struct {
+	operator string
+	version  *version.Version
+	segments int
+}
+
+// parseVersionConstraint parses a single constraint such as ">= 1.2.0".
+func parseVersionConstraint(raw string) (*versionConstraint, error) {
+	matches := versionConstraintRegexp.FindStringSubmatch(raw)
+	if matches == nil {
+		return nil, fmt.Errorf("malformed version constraint: %q", raw)
+	}
+
+	v, err := version.NewVersion(matches[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return &versionConstraint{
+		operator: matches[1],
+		version:  v,
+		segments: strings.Count(matches[3], ".") + 1,
+	}, nil
+}
+
+// check reports whether v satisfies the constraint.
+func (c *versionConstraint) check(v *version.Version) bool {
+	result := compareVersions(v, c.version)
+	switch c.operator {
+	case "!=":
+		return result != 0
+	case ">":
+		return result > 0
+	case "<":
+		return result < 0
+	case ">=":
+		return result >= 0
+	case "<=":
+		return result <= 0
+	case "~>":
+		// Every segment but the last one given in the constraint must match
+		if result < 0 {
+			return false
+		}
+		for i := 0; i < c.segments-1; i++ {
+			if v.Segments()[i] != c.version.Segments()[i] {
+				return false
+			}
+		}
+		return true
+	default:
+		return result == 0
+	}
+}
+
+// compareVersions returns -1, 0 or 1 if a is lower than, equal to or higher
+// than b, following the precedence rules of Semantic Versioning 2.0.0. The
+// vendored go-version compares numeric pre-release identifiers as strings,
+// so those are compared here instead.
+func compareVersions(a, b *version.Version) int {
+	sa := a.Segments()
+	sb := b.Segments()
+	for i := range sa {
+		if sa[i] < sb[i] {
+			return -1
+		}
+		if sa[i] > sb[i] {
+			return 1
+		}
+	}
+
+	// A release sorts after any of its pre-releases
+	pa := a.Prerelease()
+	pb := b.Prerelease()
+	switch {
+	case pa == pb:
+		return 0
+	case pa == "":
+		return 1
+	case pb == "":
+		return -1
+	}
+
+	ia := strings.Split(pa, ".")
+	ib := strings.Split(pb, ".")
+	for i := 0; i < len(ia) && i < len(ib); i++ {
+		if result := comparePrereleaseIdentifiers(ia[i], ib[i]); result != 0 {
+			return result
+		}
+	}
+
+	// A larger set of identifiers sorts higher if all the preceding ones
+	// are equal
+	switch {
+	case len(ia) < len(ib):
+		return -1
+	case len(ia) > len(ib):
+		return 1
+	}
+
+	return 0
+}
+
+// comparePrereleaseIdentifiers compares two dot-separated parts of a
+// pre-release. Numeric identifiers are compared as numbers and always sort
+// before alphanumeric ones, which are compared as ASCII strings.
+func comparePrereleaseIdentifiers(a, b string) int {
+	aNumeric := isDigits(a)
+	bNumeric := isDigits(b)
+	switch {
+	case aNumeric && !bNumeric:
+		return -1
+	case !aNumeric && bNumeric:
+		return 1
+	case aNumeric && bNumeric:
+		// Compare by length first so large numbers can't overflow
+		a = strings.TrimLeft(a, "0")
+		b = strings.TrimLeft(b, "0")
+		if len(a) != len(b) {
+			if len(a) < len(b) {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return strings.Compare(a, b)
+}
+
+// isDigits reports whether s is made up only of ASCII digits.
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// interpolationFuncWeightedChoice implements the "weightedchoice" function
+// that picks one element of a list with probability proportional to the
+// matching entry of a list of weights. The pick is driven by a hash of the
+// seed rather than a random source, so the same seed always yields the
+// same element and the result is stable between plan and apply.
+func interpolationFuncWeightedChoice() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeList, ast.TypeList, ast.TypeString},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			choices, err := listVariableValueToStringSlice(args[0].([]ast.Variable))
+			if err != nil {
+				return nil, err
+			}
+			rawWeights, err := listVariableValueToStringSlice(args[1].([]ast.Variable))
+			if err != nil {
+				return nil, err
+			}
+			if len(choices) != len(rawWeights) {
+				return nil, fmt.Errorf(
+					"mismatched list lengths: %d choices, %d weights",
+					len(choices), len(rawWeights))
+			}
+
+			weights := make([]uint64, len(rawWeights))
+			var total uint64
+			for i, raw := range rawWeights {
+				weight, err := strconv.ParseUint(raw, 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf(
+						"weight %d must be a non-negative integer, got %q", i, raw)
+				}
+				weights[i] = weight
+				total += weight
+			}
+			if total == 0 {
+				return nil, fmt.Errorf("weights must add up to more than zero")
+			}
+
+			h := fnv.New64a()
+			h.Write([]byte(args[2].(string)))
+			point := h.Sum64() % total
+
+			for i, weight := range weights {
+				if point < weight {
+					return choices[i], nil
+				}
+				point -= weight
+			}
+
+			return nil, fmt.Errorf("weightedchoice: internal error selecting element")
+		},
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/hil"
@@ -222,6 +223,72 @@ func TestInterpolateFuncCompact(t *testing.T) {
 	})
 }
 
+func TestInterpolateFuncCommonPrefix(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Vars: map[string]ast.Variable{
+			"var.paths":    interfaceToVariableSwallowError([]string{"/srv/app/bin", "/srv/app/lib", "/srv/apply"}),
+			"var.same":     interfaceToVariableSwallowError([]string{"web", "web"}),
+			"var.disjoint": interfaceToVariableSwallowError([]string{"web", "db"}),
+			"var.single":   interfaceToVariableSwallowError([]string{"only"}),
+			"var.empty":    interfaceToVariableSwallowError([]interface{}{}),
+			"var.unicode":  interfaceToVariableSwallowError([]string{"日本語", "日本人"}),
+			"var.accents":  interfaceToVariableSwallowError([]string{"é1", "è2"}),
+			"var.nested":   interfaceToVariableSwallowError([]interface{}{[]string{"a"}}),
+		},
+		Cases: []testFunctionCase{
+			{
+				`${commonprefix(var.paths)}`,
+				"/srv/app",
+				false,
+			},
+
+			{
+				`${commonprefix(var.same)}`,
+				"web",
+				false,
+			},
+
+			{
+				`${commonprefix(var.disjoint)}`,
+				"",
+				false,
+			},
+
+			{
+				`${commonprefix(var.single)}`,
+				"only",
+				false,
+			},
+
+			{
+				`${commonprefix(var.empty)}`,
+				"",
+				false,
+			},
+
+			// Multi-byte characters are compared whole
+			{
+				`${commonprefix(var.unicode)}`,
+				"日本",
+				false,
+			},
+
+			// é and è share their first byte, but not the character
+			{
+				`${commonprefix(var.accents)}`,
+				"",
+				false,
+			},
+
+			{
+				`${commonprefix(var.nested)}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
 func TestInterpolateFuncCidrHost(t *testing.T) {
 	testFunction(t, testFunctionConfig{
 		Cases: []testFunctionCase{
@@ -358,6 +425,108 @@ func TestInterpolateFuncCoalesce(t *testing.T) {
 	})
 }
 
+func TestInterpolateFuncContains(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Vars: map[string]ast.Variable{
+			"var.a_list": interfaceToVariableSwallowError([]string{"foo", "bar"}),
+			"var.a_map": interfaceToVariableSwallowError(map[string]interface{}{
+				"foo": "baz",
+			}),
+			"var.a_nested_list": interfaceToVariableSwallowError([]interface{}{[]string{"foo"}}),
+		},
+		Cases: []testFunctionCase{
+			{
+				`${contains(var.a_list, "bar")}`,
+				"true",
+				false,
+			},
+
+			{
+				`${contains(var.a_list, "baz")}`,
+				"false",
+				false,
+			},
+
+			// Maps are checked for the key, not the value
+			{
+				`${contains(var.a_map, "foo")}`,
+				"true",
+				false,
+			},
+
+			{
+				`${contains(var.a_map, "baz")}`,
+				"false",
+				false,
+			},
+
+			// Only string elements can match
+			{
+				`${contains(var.a_nested_list, "foo")}`,
+				"false",
+				false,
+			},
+
+			{
+				`${contains("foo", "foo")}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
+func TestInterpolateFuncDefault(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Vars: map[string]ast.Variable{
+			"var.empty": interfaceToVariableSwallowError(""),
+			"var.space": interfaceToVariableSwallowError(" "),
+			"var.set":   interfaceToVariableSwallowError("us-east-1"),
+			"var.list":  interfaceToVariableSwallowError([]string{}),
+		},
+		Cases: []testFunctionCase{
+			{
+				`${default(var.empty, "us-west-2")}`,
+				"us-west-2",
+				false,
+			},
+
+			{
+				`${default(var.set, "us-west-2")}`,
+				"us-east-1",
+				false,
+			},
+
+			// Whitespace is not empty
+			{
+				`${default(var.space, "us-west-2")}`,
+				" ",
+				false,
+			},
+
+			// Zero is not empty
+			{
+				`${default(0, 5)}`,
+				"0",
+				false,
+			},
+
+			// Lists are not supported
+			{
+				`${default(var.list, "us-west-2")}`,
+				nil,
+				true,
+			},
+
+			{
+				`${default(var.empty)}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
 func TestInterpolateFuncConcat(t *testing.T) {
 	testFunction(t, testFunctionConfig{
 		Cases: []testFunctionCase{
@@ -595,6 +764,85 @@ func TestInterpolateFuncMerge(t *testing.T) {
 
 }
 
+func TestInterpolateFuncDeepMerge(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Vars: map[string]ast.Variable{
+			"var.base": interfaceToVariableSwallowError(map[string]interface{}{
+				"name": "web",
+				"tags": map[string]interface{}{
+					"env":  "dev",
+					"team": "ops",
+				},
+				"ports": []interface{}{"80", "443"},
+			}),
+			"var.override": interfaceToVariableSwallowError(map[string]interface{}{
+				"tags": map[string]interface{}{
+					"env": "prod",
+				},
+				"ports": []interface{}{"8080"},
+			}),
+			"var.conflict": interfaceToVariableSwallowError(map[string]interface{}{
+				"name": map[string]interface{}{"first": "web"},
+				"tags": "none",
+			}),
+		},
+		Cases: []testFunctionCase{
+			// Nested maps are merged, lists are replaced
+			{
+				`${deepmerge(var.base, var.override)}`,
+				map[string]interface{}{
+					"name": "web",
+					"tags": map[string]interface{}{
+						"env":  "prod",
+						"team": "ops",
+					},
+					"ports": []interface{}{"8080"},
+				},
+				false,
+			},
+
+			// Differing types at the same key: last in wins
+			{
+				`${deepmerge(var.base, var.conflict)}`,
+				map[string]interface{}{
+					"name":  map[string]interface{}{"first": "web"},
+					"tags":  "none",
+					"ports": []interface{}{"80", "443"},
+				},
+				false,
+			},
+
+			// The inputs are left untouched
+			{
+				`${var.base}`,
+				map[string]interface{}{
+					"name": "web",
+					"tags": map[string]interface{}{
+						"env":  "dev",
+						"team": "ops",
+					},
+					"ports": []interface{}{"80", "443"},
+				},
+				false,
+			},
+
+			{
+				`${deepmerge(map("a", map("b", "c")), map("a", map("d", "e")), map("a", map("b", "f")))}`,
+				map[string]interface{}{
+					"a": map[string]interface{}{"b": "f", "d": "e"},
+				},
+				false,
+			},
+
+			{
+				`${deepmerge(var.base, list("a"))}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
 func TestInterpolateFuncDistinct(t *testing.T) {
 	testFunction(t, testFunctionConfig{
 		Cases: []testFunctionCase{
@@ -626,6 +874,99 @@ func TestInterpolateFuncDistinct(t *testing.T) {
 	})
 }
 
+func TestInterpolateFuncEscape(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Vars: map[string]ast.Variable{
+			"var.text":    interfaceToVariableSwallowError("say \"hi\" <b>it's</b> a\\b & c\n"),
+			"var.literal": interfaceToVariableSwallowError(`\u003c`),
+		},
+		Cases: []testFunctionCase{
+			{
+				`${escape(var.text, "json")}`,
+				`say \"hi\" <b>it's</b> a\\b & c\n`,
+				false,
+			},
+
+			{
+				`${escape(var.literal, "json")}`,
+				`\\u003c`,
+				false,
+			},
+
+			{
+				`${escape(var.text, "shell")}`,
+				"'say \"hi\" <b>it'\\''s</b> a\\b & c\n'",
+				false,
+			},
+
+			{
+				`${escape(var.text, "html")}`,
+				"say &#34;hi&#34; &lt;b&gt;it&#39;s&lt;/b&gt; a\\b &amp; c\n",
+				false,
+			},
+
+			{
+				`${escape("", "shell")}`,
+				"''",
+				false,
+			},
+
+			{
+				`${escape("foo", "xml")}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
+func TestInterpolateFuncInterleave(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Vars: map[string]ast.Variable{
+			"var.nested": interfaceToVariableSwallowError([]interface{}{[]string{"x"}}),
+		},
+		Cases: []testFunctionCase{
+			{
+				`${interleave(list("a0", "a1"), list("b0", "b1"))}`,
+				[]interface{}{"a0", "b0", "a1", "b1"},
+				false,
+			},
+
+			// Remainder of the longer list goes at the end
+			{
+				`${interleave(list("a0", "a1", "a2", "a3"), list("b0"))}`,
+				[]interface{}{"a0", "b0", "a1", "a2", "a3"},
+				false,
+			},
+
+			{
+				`${interleave(list("a0"), list("b0", "b1", "b2"))}`,
+				[]interface{}{"a0", "b0", "b1", "b2"},
+				false,
+			},
+
+			{
+				`${interleave(list(), list("b0", "b1"))}`,
+				[]interface{}{"b0", "b1"},
+				false,
+			},
+
+			{
+				`${interleave(list(), list())}`,
+				[]interface{}{},
+				false,
+			},
+
+			// Element types must match
+			{
+				`${interleave(list("a0"), var.nested)}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
 func TestInterpolateFuncFile(t *testing.T) {
 	tf, err := ioutil.TempFile("", "tf")
 	if err != nil {
@@ -780,6 +1121,49 @@ func TestInterpolateFuncIndex(t *testing.T) {
 	})
 }
 
+func TestInterpolateFuncIndexOfOr(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Vars: map[string]ast.Variable{
+			"var.list1": interfaceToVariableSwallowError([]string{"notfoo", "stillnotfoo", "bar"}),
+			"var.list2": interfaceToVariableSwallowError([]string{"foo", "spam", "foo"}),
+			"var.list3": interfaceToVariableSwallowError([]string{"1", "2", "3"}),
+		},
+		Cases: []testFunctionCase{
+			{
+				`${indexof_or(var.list1, "foo", -1)}`,
+				"-1",
+				false,
+			},
+
+			// First occurrence wins
+			{
+				`${indexof_or(var.list2, "foo", -1)}`,
+				"0",
+				false,
+			},
+
+			{
+				`${indexof_or(var.list1, "bar", -1)}`,
+				"2",
+				false,
+			},
+
+			// Numbers are compared as their string form
+			{
+				`${indexof_or(var.list3, 2, -1)}`,
+				"1",
+				false,
+			},
+
+			{
+				`${indexof_or(var.list1, "foo")}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
 func TestInterpolateFuncJoin(t *testing.T) {
 	testFunction(t, testFunctionConfig{
 		Vars: map[string]ast.Variable{
@@ -948,13 +1332,225 @@ func TestInterpolateFuncReplace(t *testing.T) {
 	})
 }
 
-func TestInterpolateFuncLength(t *testing.T) {
+func TestInterpolateFuncRegexCapture(t *testing.T) {
 	testFunction(t, testFunctionConfig{
 		Cases: []testFunctionCase{
-			// Raw strings
 			{
-				`${length("")}`,
-				"0",
+				`${regexcapture("ami-1a2b3c in us-east-1", "^(ami)-([0-9a-f]+) in ([a-z0-9-]+)$")}`,
+				[]interface{}{"ami", "1a2b3c", "us-east-1"},
+				false,
+			},
+
+			// Only the first match is used
+			{
+				`${regexcapture("a1 b2", "([a-z])([0-9])")}`,
+				[]interface{}{"a", "1"},
+				false,
+			},
+
+			// Unmatched optional group
+			{
+				`${regexcapture("v1", "v([0-9])(-rc)?")}`,
+				[]interface{}{"1", ""},
+				false,
+			},
+
+			// No match
+			{
+				`${regexcapture("foo", "([0-9]+)")}`,
+				[]interface{}{},
+				false,
+			},
+
+			// Invalid pattern
+			{
+				`${regexcapture("foo", "(")}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
+func TestInterpolateFuncRegexCaptureNamed(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Cases: []testFunctionCase{
+			{
+				`${regexcapturenamed("web-03.example.com", "^(?P<role>[a-z]+)-(?P<num>[0-9]+)\\.(.*)$")}`,
+				map[string]interface{}{"role": "web", "num": "03"},
+				false,
+			},
+
+			// No match
+			{
+				`${regexcapturenamed("foo", "(?P<num>[0-9]+)")}`,
+				map[string]interface{}{},
+				false,
+			},
+
+			// Invalid pattern
+			{
+				`${regexcapturenamed("foo", "(?P<num")}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
+func TestInterpolateFuncRegexSplit(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Cases: []testFunctionCase{
+			{
+				`${regexsplit("a, b,c ,  d", "\\s*,\\s*")}`,
+				[]interface{}{"a", "b", "c", "d"},
+				false,
+			},
+
+			// Multi-character delimiter
+			{
+				`${regexsplit("foo--bar---baz", "-{2,}")}`,
+				[]interface{}{"foo", "bar", "baz"},
+				false,
+			},
+
+			// No match returns the whole string
+			{
+				`${regexsplit("foo", ",")}`,
+				[]interface{}{"foo"},
+				false,
+			},
+
+			// Limit leaves the remainder unsplit
+			{
+				`${regexsplit("a1b2c3d", "[0-9]", 2)}`,
+				[]interface{}{"a", "b2c3d"},
+				false,
+			},
+
+			{
+				`${regexsplit("a1b2c3d", "[0-9]", 0)}`,
+				nil,
+				true,
+			},
+
+			// Invalid pattern
+			{
+				`${regexsplit("foo", "(")}`,
+				nil,
+				true,
+			},
+
+			{
+				`${regexsplit("a1b", "[0-9]", 1, 2)}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
+func TestInterpolateFuncReplaceCI(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Cases: []testFunctionCase{
+			{
+				`${replace_ci("Hello World, HELLO moon", "hello", "bye")}`,
+				"bye World, bye moon",
+				false,
+			},
+
+			// The rest of the string keeps its case
+			{
+				`${replace_ci("MyApp-PROD", "prod", "staging")}`,
+				"MyApp-staging",
+				false,
+			},
+
+			// Matches do not overlap
+			{
+				`${replace_ci("AAAa", "aa", "b")}`,
+				"bb",
+				false,
+			},
+
+			{
+				`${replace_ci("aAa", "aa", "b")}`,
+				"ba",
+				false,
+			},
+
+			// Multi-byte characters
+			{
+				`${replace_ci("Grüße aus MÜNCHEN", "münchen", "Berlin")}`,
+				"Grüße aus Berlin",
+				false,
+			},
+
+			{
+				`${replace_ci("ΣΊΣΥΦΟΣ", "σίσυφος", "x")}`,
+				"x",
+				false,
+			},
+
+			// No match
+			{
+				`${replace_ci("foo", "bar", "baz")}`,
+				"foo",
+				false,
+			},
+		},
+	})
+}
+
+func TestInterpolateFuncRegexValidate(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Cases: []testFunctionCase{
+			{
+				`${regexvalidate("web-01", "^[a-z]+-[0-9]+$", "name must look like role-NN")}`,
+				"web-01",
+				false,
+			},
+
+			{
+				`prefix-${regexvalidate("web-01", "^[a-z]+-[0-9]+$", "bad name")}`,
+				"prefix-web-01",
+				false,
+			},
+
+			// Non-matching input
+			{
+				`${regexvalidate("Web_01", "^[a-z]+-[0-9]+$", "name must look like role-NN")}`,
+				nil,
+				true,
+			},
+
+			// Invalid pattern
+			{
+				`${regexvalidate("web-01", "[a-z", "bad name")}`,
+				nil,
+				true,
+			},
+		},
+	})
+
+	ast, err := hil.Parse(`${regexvalidate("Web_01", "^[a-z]+-[0-9]+$", "name must look like role-NN")}`)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	_, err = hil.Eval(ast, langEvalConfig(nil))
+	if err == nil || !strings.Contains(err.Error(), "name must look like role-NN") {
+		t.Fatalf("expected the custom message in the error, got: %v", err)
+	}
+}
+
+func TestInterpolateFuncLength(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Cases: []testFunctionCase{
+			// Raw strings
+			{
+				`${length("")}`,
+				"0",
 				false,
 			},
 			{
@@ -1025,6 +1621,73 @@ func TestInterpolateFuncLength(t *testing.T) {
 	})
 }
 
+func TestInterpolateFuncBackoff(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Cases: []testFunctionCase{
+			{
+				`${backoff(1, 60, 5)}`,
+				[]interface{}{"1", "2", "4", "8", "16"},
+				false,
+			},
+
+			// Delays are capped at max
+			{
+				`${backoff(3, 20, 6)}`,
+				[]interface{}{"3", "6", "12", "20", "20", "20"},
+				false,
+			},
+
+			{
+				`${backoff(30, 10, 2)}`,
+				[]interface{}{"10", "10"},
+				false,
+			},
+
+			// Many attempts don't overflow
+			{
+				`${length(backoff(1, 3600, 100))}`,
+				"100",
+				false,
+			},
+
+			// A max close to the largest int doesn't overflow either
+			{
+				`${backoff(4611686018427387904, 4611686018427387905, 3)}`,
+				[]interface{}{
+					"4611686018427387904",
+					"4611686018427387905",
+					"4611686018427387905",
+				},
+				false,
+			},
+
+			{
+				`${backoff(1, 60, 0)}`,
+				[]interface{}{},
+				false,
+			},
+
+			{
+				`${backoff(0, 60, 3)}`,
+				nil,
+				true,
+			},
+
+			{
+				`${backoff(1, -1, 3)}`,
+				nil,
+				true,
+			},
+
+			{
+				`${backoff(1, 60, -1)}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
 func TestInterpolateFuncSignum(t *testing.T) {
 	testFunction(t, testFunctionConfig{
 		Cases: []testFunctionCase{
@@ -1061,6 +1724,107 @@ func TestInterpolateFuncSignum(t *testing.T) {
 	})
 }
 
+func TestInterpolateFuncSimilarity(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Cases: []testFunctionCase{
+			{
+				`${similarity("terraform", "terraform")}`,
+				"1",
+				false,
+			},
+
+			{
+				`${similarity("abc", "xyz")}`,
+				"0",
+				false,
+			},
+
+			{
+				`${similarity("kitten", "sitting")}`,
+				"0.5714285714285714",
+				false,
+			},
+
+			// Distance is measured in runes, not bytes
+			{
+				`${similarity("héllo", "hello")}`,
+				"0.8",
+				false,
+			},
+
+			{
+				`${similarity("日本語", "日本人")}`,
+				"0.6666666666666667",
+				false,
+			},
+
+			// Two empty strings are identical
+			{
+				`${similarity("", "")}`,
+				"1",
+				false,
+			},
+
+			{
+				`${similarity("", "abc")}`,
+				"0",
+				false,
+			},
+
+			{
+				`${similarity("abc")}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
+func TestInterpolateFuncSlugify(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Cases: []testFunctionCase{
+			{
+				`${slugify("My Web Server")}`,
+				"my-web-server",
+				false,
+			},
+
+			// Surrounding whitespace and separators are dropped
+			{
+				`${slugify("  --Hello, World!--  ")}`,
+				"hello-world",
+				false,
+			},
+
+			// Runs of punctuation collapse to one hyphen
+			{
+				`${slugify("app_v2.0 / (staging)")}`,
+				"app-v2-0-staging",
+				false,
+			},
+
+			// Non-ASCII characters are transliterated
+			{
+				`${slugify("Café Münster")}`,
+				"cafe-munster",
+				false,
+			},
+
+			{
+				`${slugify("日本")}`,
+				"ri-ben",
+				false,
+			},
+
+			{
+				`${slugify("!!!")}`,
+				"",
+				false,
+			},
+		},
+	})
+}
+
 func TestInterpolateFuncSort(t *testing.T) {
 	testFunction(t, testFunctionConfig{
 		Vars: map[string]ast.Variable{
@@ -1111,32 +1875,86 @@ func TestInterpolateFuncSplit(t *testing.T) {
 			},
 
 			{
-				`${split(",", "foo")}`,
-				[]interface{}{"foo"},
+				`${split(",", "foo")}`,
+				[]interface{}{"foo"},
+				false,
+			},
+
+			{
+				`${split(",", ",,,")}`,
+				[]interface{}{"", "", "", ""},
+				false,
+			},
+
+			{
+				`${split(",", "foo,")}`,
+				[]interface{}{"foo", ""},
+				false,
+			},
+
+			{
+				`${split(",", ",foo,")}`,
+				[]interface{}{"", "foo", ""},
+				false,
+			},
+
+			{
+				`${split(".", "foo.bar.baz")}`,
+				[]interface{}{"foo", "bar", "baz"},
+				false,
+			},
+		},
+	})
+}
+
+func TestInterpolateFuncToMapBy(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Vars: map[string]ast.Variable{
+			"var.users": interfaceToVariableSwallowError([]interface{}{
+				map[string]interface{}{"name": "alice", "role": "admin"},
+				map[string]interface{}{"name": "bob", "role": "dev"},
+			}),
+			"var.dupes": interfaceToVariableSwallowError([]interface{}{
+				map[string]interface{}{"name": "alice", "role": "admin"},
+				map[string]interface{}{"name": "alice", "role": "dev"},
+			}),
+			"var.strings": interfaceToVariableSwallowError([]string{"alice"}),
+			"var.empty":   interfaceToVariableSwallowError([]interface{}{}),
+		},
+		Cases: []testFunctionCase{
+			{
+				`${tomap_by(var.users, "name")}`,
+				map[string]interface{}{
+					"alice": map[string]interface{}{"name": "alice", "role": "admin"},
+					"bob":   map[string]interface{}{"name": "bob", "role": "dev"},
+				},
 				false,
 			},
 
+			// Duplicate keys
 			{
-				`${split(",", ",,,")}`,
-				[]interface{}{"", "", "", ""},
-				false,
+				`${tomap_by(var.dupes, "name")}`,
+				nil,
+				true,
 			},
 
+			// Missing key
 			{
-				`${split(",", "foo,")}`,
-				[]interface{}{"foo", ""},
-				false,
+				`${tomap_by(var.users, "email")}`,
+				nil,
+				true,
 			},
 
+			// Elements must be maps
 			{
-				`${split(",", ",foo,")}`,
-				[]interface{}{"", "foo", ""},
-				false,
+				`${tomap_by(var.strings, "name")}`,
+				nil,
+				true,
 			},
 
 			{
-				`${split(".", "foo.bar.baz")}`,
-				[]interface{}{"foo", "bar", "baz"},
+				`${tomap_by(var.empty, "name")}`,
+				map[string]interface{}{},
 				false,
 			},
 		},
@@ -1389,6 +2207,60 @@ func interfaceToVariableSwallowError(input interface{}) ast.Variable {
 	return variable
 }
 
+func TestInterpolateFuncMapToList(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Vars: map[string]ast.Variable{
+			"var.env": interfaceToVariableSwallowError(map[string]interface{}{
+				"PORT":     "8080",
+				"APP_NAME": "web",
+				"DEBUG":    "",
+			}),
+			"var.nested": interfaceToVariableSwallowError(map[string]interface{}{
+				"list": []string{"a"},
+			}),
+		},
+		Cases: []testFunctionCase{
+			// Sorted by key
+			{
+				`${maptolist(var.env)}`,
+				[]interface{}{"APP_NAME=web", "DEBUG=", "PORT=8080"},
+				false,
+			},
+
+			{
+				`${maptolist(var.env, ": ")}`,
+				[]interface{}{"APP_NAME: web", "DEBUG: ", "PORT: 8080"},
+				false,
+			},
+
+			{
+				`${maptolist(map())}`,
+				[]interface{}{},
+				false,
+			},
+
+			{
+				`${join(" ", maptolist(map("b", "2", "a", "1")))}`,
+				"a=1 b=2",
+				false,
+			},
+
+			// Only flat maps
+			{
+				`${maptolist(var.nested)}`,
+				nil,
+				true,
+			},
+
+			{
+				`${maptolist(var.env, "=", "=")}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
 func TestInterpolateFuncElement(t *testing.T) {
 	testFunction(t, testFunctionConfig{
 		Vars: map[string]ast.Variable{
@@ -1399,48 +2271,290 @@ func TestInterpolateFuncElement(t *testing.T) {
 		},
 		Cases: []testFunctionCase{
 			{
-				`${element(var.a_list, "1")}`,
-				"baz",
+				`${element(var.a_list, "1")}`,
+				"baz",
+				false,
+			},
+
+			{
+				`${element(var.a_short_list, "0")}`,
+				"foo",
+				false,
+			},
+
+			// Invalid index should wrap vs. out-of-bounds
+			{
+				`${element(var.a_list, "2")}`,
+				"foo",
+				false,
+			},
+
+			// Negative number should fail
+			{
+				`${element(var.a_short_list, "-1")}`,
+				nil,
+				true,
+			},
+
+			// Empty list should fail
+			{
+				`${element(var.empty_list, 0)}`,
+				nil,
+				true,
+			},
+
+			// Too many args
+			{
+				`${element(var.a_list, "0", "2")}`,
+				nil,
+				true,
+			},
+
+			// Only works on single-level lists
+			{
+				`${element(var.a_nested_list, "0")}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
+func TestInterpolateFuncDig(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Vars: map[string]ast.Variable{
+			"var.nested": interfaceToVariableSwallowError(map[string]interface{}{
+				"a": map[string]interface{}{
+					"b": []interface{}{
+						map[string]interface{}{
+							"c": "found",
+						},
+					},
+				},
+			}),
+			"var.a_list": interfaceToVariableSwallowError([]string{"foo", "baz"}),
+		},
+		Cases: []testFunctionCase{
+			{
+				`${dig(var.nested, "a.b.0.c")}`,
+				"found",
+				false,
+			},
+
+			{
+				`${dig(var.a_list, "1")}`,
+				"baz",
+				false,
+			},
+
+			// Missing key at the first level
+			{
+				`${dig(var.nested, "x.b.0.c")}`,
+				nil,
+				true,
+			},
+
+			// Non-numeric segment into a list
+			{
+				`${dig(var.nested, "a.b.x.c")}`,
+				nil,
+				true,
+			},
+
+			// Index out of range
+			{
+				`${dig(var.nested, "a.b.1.c")}`,
+				nil,
+				true,
+			},
+
+			// Missing key at the last level
+			{
+				`${dig(var.nested, "a.b.0.d")}`,
+				nil,
+				true,
+			},
+
+			// Path continues past a string
+			{
+				`${dig(var.nested, "a.b.0.c.d")}`,
+				nil,
+				true,
+			},
+
+			// Path ends at a list
+			{
+				`${dig(var.nested, "a.b")}`,
+				nil,
+				true,
+			},
+
+			// Empty path
+			{
+				`${dig(var.nested, "")}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
+func TestInterpolateFuncBase64Encode(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Cases: []testFunctionCase{
+			// Regular base64 encoding
+			{
+				`${base64encode("abc123!?$*&()'-=@~")}`,
+				"YWJjMTIzIT8kKiYoKSctPUB+",
+				false,
+			},
+		},
+	})
+}
+
+func TestInterpolateFuncBase64Decode(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Cases: []testFunctionCase{
+			// Regular base64 decoding
+			{
+				`${base64decode("YWJjMTIzIT8kKiYoKSctPUB+")}`,
+				"abc123!?$*&()'-=@~",
+				false,
+			},
+
+			// Invalid base64 data decoding
+			{
+				`${base64decode("this-is-an-invalid-base64-data")}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
+func TestInterpolateFuncLower(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Cases: []testFunctionCase{
+			{
+				`${lower("HELLO")}`,
+				"hello",
+				false,
+			},
+
+			{
+				`${lower("")}`,
+				"",
+				false,
+			},
+
+			{
+				`${lower()}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
+func TestInterpolateFuncPadLeft(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Cases: []testFunctionCase{
+			{
+				`${padleft("7", 3, "0")}`,
+				"007",
+				false,
+			},
+
+			// Defaults to spaces
+			{
+				`[${padleft("ab", 5)}]`,
+				"[   ab]",
+				false,
+			},
+
+			// Multi-character pad is cut to fit
+			{
+				`${padleft("x", 6, "ab")}`,
+				"ababax",
+				false,
+			},
+
+			// Width is counted in characters
+			{
+				`${padleft("日本", 4, "·")}`,
+				"··日本",
+				false,
+			},
+
+			// Long strings are left as they are
+			{
+				`${padleft("abcdef", 3, "0")}`,
+				"abcdef",
+				false,
+			},
+
+			{
+				`${padleft("a", 3, "")}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
+func TestInterpolateFuncPadRight(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Cases: []testFunctionCase{
+			{
+				`${padright("name", 8, ".")}`,
+				"name....",
+				false,
+			},
+
+			{
+				`[${padright("ab", 5)}]`,
+				"[ab   ]",
 				false,
 			},
 
 			{
-				`${element(var.a_short_list, "0")}`,
-				"foo",
+				`${padright("x", 4, "→·")}`,
+				"x→·→",
 				false,
 			},
 
-			// Invalid index should wrap vs. out-of-bounds
 			{
-				`${element(var.a_list, "2")}`,
-				"foo",
+				`${padright("abc", 3, "-")}`,
+				"abc",
 				false,
 			},
 
-			// Negative number should fail
 			{
-				`${element(var.a_short_list, "-1")}`,
+				`${padright("a", 3, "-", "-")}`,
 				nil,
 				true,
 			},
+		},
+	})
+}
 
-			// Empty list should fail
+func TestInterpolateFuncUpper(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Cases: []testFunctionCase{
 			{
-				`${element(var.empty_list, 0)}`,
-				nil,
-				true,
+				`${upper("hello")}`,
+				"HELLO",
+				false,
 			},
 
-			// Too many args
 			{
-				`${element(var.a_list, "0", "2")}`,
-				nil,
-				true,
+				`${upper("")}`,
+				"",
+				false,
 			},
 
-			// Only works on single-level lists
 			{
-				`${element(var.a_nested_list, "0")}`,
+				`${upper()}`,
 				nil,
 				true,
 			},
@@ -1448,56 +2562,61 @@ func TestInterpolateFuncElement(t *testing.T) {
 	})
 }
 
-func TestInterpolateFuncBase64Encode(t *testing.T) {
+func TestInterpolateFuncSha1(t *testing.T) {
 	testFunction(t, testFunctionConfig{
 		Cases: []testFunctionCase{
-			// Regular base64 encoding
 			{
-				`${base64encode("abc123!?$*&()'-=@~")}`,
-				"YWJjMTIzIT8kKiYoKSctPUB+",
+				`${sha1("test")}`,
+				"a94a8fe5ccb19ba61c4c0873d391e987982fbbd3",
 				false,
 			},
 		},
 	})
 }
 
-func TestInterpolateFuncBase64Decode(t *testing.T) {
+func TestInterpolateFuncSha256(t *testing.T) {
 	testFunction(t, testFunctionConfig{
 		Cases: []testFunctionCase{
-			// Regular base64 decoding
-			{
-				`${base64decode("YWJjMTIzIT8kKiYoKSctPUB+")}`,
-				"abc123!?$*&()'-=@~",
+			{ // hexadecimal representation of sha256 sum
+				`${sha256("test")}`,
+				"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
 				false,
 			},
-
-			// Invalid base64 data decoding
-			{
-				`${base64decode("this-is-an-invalid-base64-data")}`,
-				nil,
-				true,
-			},
 		},
 	})
 }
 
-func TestInterpolateFuncLower(t *testing.T) {
+func TestInterpolateFuncChecksum(t *testing.T) {
 	testFunction(t, testFunctionConfig{
+		Vars: map[string]ast.Variable{
+			"var.files":     interfaceToVariableSwallowError([]string{"alpha", "beta", "gamma"}),
+			"var.reordered": interfaceToVariableSwallowError([]string{"gamma", "alpha", "beta"}),
+			"var.changed":   interfaceToVariableSwallowError([]string{"alpha", "beta", "delta"}),
+			"var.nested":    interfaceToVariableSwallowError([]interface{}{[]string{"alpha"}}),
+		},
 		Cases: []testFunctionCase{
 			{
-				`${lower("HELLO")}`,
-				"hello",
+				`${checksum(var.files)}`,
+				"0f395313bde512d767aa5f9188f47906271c1e5080a3266a2b90df48d5880d6b",
 				false,
 			},
 
+			// Order does not matter
 			{
-				`${lower("")}`,
-				"",
+				`${checksum(var.reordered)}`,
+				"0f395313bde512d767aa5f9188f47906271c1e5080a3266a2b90df48d5880d6b",
 				false,
 			},
 
 			{
-				`${lower()}`,
+				`${checksum(var.changed)}`,
+				"4ffa21212883c0339ddd597e51054b84f1798c24c6993901760ef4652afaf485",
+				false,
+			},
+
+			// Only flat lists of strings
+			{
+				`${checksum(var.nested)}`,
 				nil,
 				true,
 			},
@@ -1505,48 +2624,89 @@ func TestInterpolateFuncLower(t *testing.T) {
 	})
 }
 
-func TestInterpolateFuncUpper(t *testing.T) {
+func TestInterpolateFuncTrim(t *testing.T) {
 	testFunction(t, testFunctionConfig{
 		Cases: []testFunctionCase{
 			{
-				`${upper("hello")}`,
-				"HELLO",
+				`${trim("--==foo=bar==--", "-=")}`,
+				"foo=bar",
 				false,
 			},
 
+			// Characters inside the string are kept
 			{
-				`${upper("")}`,
-				"",
+				`${trim("xxhelloxworldxx", "x")}`,
+				"helloxworld",
 				false,
 			},
 
 			{
-				`${upper()}`,
-				nil,
-				true,
+				`${trim("foo", "")}`,
+				"foo",
+				false,
+			},
+
+			// Multi-byte cutset characters
+			{
+				`${trim("«¡hola!»", "«»¡!")}`,
+				"hola",
+				false,
 			},
 		},
 	})
 }
 
-func TestInterpolateFuncSha1(t *testing.T) {
+func TestInterpolateFuncTrimPrefix(t *testing.T) {
 	testFunction(t, testFunctionConfig{
 		Cases: []testFunctionCase{
 			{
-				`${sha1("test")}`,
-				"a94a8fe5ccb19ba61c4c0873d391e987982fbbd3",
+				`${trimprefix("arn:aws:iam::123", "arn:aws:")}`,
+				"iam::123",
+				false,
+			},
+
+			// Prefix not present
+			{
+				`${trimprefix("iam::123", "arn:aws:")}`,
+				"iam::123",
+				false,
+			},
+
+			// Only removed once
+			{
+				`${trimprefix("aaab", "a")}`,
+				"aab",
+				false,
+			},
+
+			{
+				`${trimprefix("日本語", "日本")}`,
+				"語",
 				false,
 			},
 		},
 	})
 }
 
-func TestInterpolateFuncSha256(t *testing.T) {
+func TestInterpolateFuncTrimSuffix(t *testing.T) {
 	testFunction(t, testFunctionConfig{
 		Cases: []testFunctionCase{
-			{ // hexadecimal representation of sha256 sum
-				`${sha256("test")}`,
-				"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+			{
+				`${trimsuffix("example.com.", ".")}`,
+				"example.com",
+				false,
+			},
+
+			// Suffix not present
+			{
+				`${trimsuffix("example.com", ".org")}`,
+				"example.com",
+				false,
+			},
+
+			{
+				`${trimsuffix("日本語", "語")}`,
+				"日本",
 				false,
 			},
 		},
@@ -1626,6 +2786,214 @@ func TestInterpolateFuncUUID(t *testing.T) {
 	}
 }
 
+func TestInterpolateFuncVersionCompare(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Cases: []testFunctionCase{
+			{
+				`${versioncompare("1.2.3", "1.2.3")}`,
+				"0",
+				false,
+			},
+
+			{
+				`${versioncompare("1.2.3", "1.10.0")}`,
+				"-1",
+				false,
+			},
+
+			{
+				`${versioncompare("2.0", "1.9.9")}`,
+				"1",
+				false,
+			},
+
+			// Pre-releases come before the release
+			{
+				`${versioncompare("1.0.0-beta", "1.0.0")}`,
+				"-1",
+				false,
+			},
+
+			{
+				`${versioncompare("1.0.0-beta.2", "1.0.0-beta.3")}`,
+				"-1",
+				false,
+			},
+
+			{
+				`${versioncompare("1.0.0-alpha", "1.0.0-beta")}`,
+				"-1",
+				false,
+			},
+
+			// Numeric identifiers are compared as numbers
+			{
+				`${versioncompare("1.0.0-alpha.10", "1.0.0-alpha.2")}`,
+				"1",
+				false,
+			},
+
+			// Numeric identifiers sort before alphanumeric ones
+			{
+				`${versioncompare("1.0.0-alpha.1", "1.0.0-alpha.beta")}`,
+				"-1",
+				false,
+			},
+
+			// More identifiers sort higher when the rest are equal
+			{
+				`${versioncompare("1.0.0-alpha", "1.0.0-alpha.1")}`,
+				"-1",
+				false,
+			},
+
+			// Build metadata is ignored
+			{
+				`${versioncompare("1.0.0+build.1", "1.0.0+build.2")}`,
+				"0",
+				false,
+			},
+
+			{
+				`${versioncompare("1.0.0", "not-a-version")}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
+func TestInterpolateFuncVersionSatisfies(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Cases: []testFunctionCase{
+			{
+				`${versionsatisfies("1.5.0", ">= 1.2.0, < 2.0.0")}`,
+				"true",
+				false,
+			},
+
+			{
+				`${versionsatisfies("2.0.0", ">= 1.2.0, < 2.0.0")}`,
+				"false",
+				false,
+			},
+
+			{
+				`${versionsatisfies("1.2.9", "~> 1.2.0")}`,
+				"true",
+				false,
+			},
+
+			{
+				`${versionsatisfies("1.3.0", "~> 1.2.0")}`,
+				"false",
+				false,
+			},
+
+			{
+				`${versionsatisfies("1.2.0+build.5", "= 1.2.0")}`,
+				"true",
+				false,
+			},
+
+			{
+				`${versionsatisfies("1.0.0-rc.10", "> 1.0.0-rc.9")}`,
+				"true",
+				false,
+			},
+
+			{
+				`${versionsatisfies("1.2.0", "!= 1.2.0")}`,
+				"false",
+				false,
+			},
+
+			// Malformed version
+			{
+				`${versionsatisfies("one", ">= 1.0")}`,
+				nil,
+				true,
+			},
+
+			// Malformed constraint
+			{
+				`${versionsatisfies("1.0.0", "=> 1.0")}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
+func TestInterpolateFuncWeightedChoice(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Vars: map[string]ast.Variable{
+			"var.colors":  interfaceToVariableSwallowError([]string{"blue", "green"}),
+			"var.weights": interfaceToVariableSwallowError([]string{"7", "3"}),
+			"var.three":   interfaceToVariableSwallowError([]string{"a", "b", "c"}),
+			"var.only_b":  interfaceToVariableSwallowError([]string{"0", "4", "0"}),
+			"var.zeroes":  interfaceToVariableSwallowError([]string{"0", "0"}),
+			"var.neg":     interfaceToVariableSwallowError([]string{"-1", "3"}),
+			"var.word":    interfaceToVariableSwallowError([]string{"heavy", "3"}),
+		},
+		Cases: []testFunctionCase{
+			// The same seed always picks the same element
+			{
+				`${weightedchoice(var.colors, var.weights, "web-0")}`,
+				"green",
+				false,
+			},
+
+			{
+				`${weightedchoice(var.colors, var.weights, "web-2")}`,
+				"blue",
+				false,
+			},
+
+			// Zero weights are never picked
+			{
+				`${weightedchoice(var.three, var.only_b, "web-0")}`,
+				"b",
+				false,
+			},
+
+			{
+				`${weightedchoice(var.three, var.only_b, "web-3")}`,
+				"b",
+				false,
+			},
+
+			// Mismatched lengths
+			{
+				`${weightedchoice(var.three, var.weights, "web-0")}`,
+				nil,
+				true,
+			},
+
+			// Weights must add up to more than zero
+			{
+				`${weightedchoice(var.colors, var.zeroes, "web-0")}`,
+				nil,
+				true,
+			},
+
+			// Negative weight
+			{
+				`${weightedchoice(var.colors, var.neg, "web-0")}`,
+				nil,
+				true,
+			},
+
+			// Non-numeric weight
+			{
+				`${weightedchoice(var.colors, var.word, "web-0")}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
 type testFunctionConfig struct {
 	Cases []testFunctionCase
 	Vars  map[string]ast.Variable